@@ -3,10 +3,11 @@ package main
 import (
 	"github.com/aws/aws-cdk-go/awscdk/v2"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awsapigateway"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awsiam"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awslambda"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awslambdaeventsources"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awss3"
-
-	// "github.com/aws/aws-cdk-go/awscdk/v2/awssqs"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awssqs"
 	"github.com/aws/constructs-go/constructs/v10"
 	"github.com/aws/jsii-runtime-go"
 )
@@ -25,16 +26,56 @@ func NewCdkGoStack(scope constructs.Construct, id string, props *CdkGoStackProps
 	// S3: 記事格納用
 	bucket := awss3.NewBucket(stack, jsii.String("BlogPosts"), &awss3.BucketProps{})
 
+	// SQS: 記事書き込みの非同期パイプライン(DLQ付き)
+	// FIFOキューにすることでMessageGroupId/MessageDeduplicationIdによる
+	// 記事単位の順序保証と重複排除が効くようにする(標準キューでは効かない)
+	dlq := awssqs.NewQueue(stack, jsii.String("BlogWriteDLQ"), &awssqs.QueueProps{
+		Fifo:            jsii.Bool(true),
+		RetentionPeriod: awscdk.Duration_Days(jsii.Number(14)),
+	})
+	writeQueue := awssqs.NewQueue(stack, jsii.String("BlogWriteQueue"), &awssqs.QueueProps{
+		Fifo:              jsii.Bool(true),
+		VisibilityTimeout: awscdk.Duration_Seconds(jsii.Number(30)),
+		DeadLetterQueue: &awssqs.DeadLetterQueue{
+			Queue:           dlq,
+			MaxReceiveCount: jsii.Number(5),
+		},
+	})
+
 	// Lambda: 事前にビルドしたZIPアセットを使用
 	fn := awslambda.NewFunction(stack, jsii.String("BlogApi"), &awslambda.FunctionProps{
 		Runtime: awslambda.Runtime_PROVIDED_AL2(),
 		Handler: jsii.String("bootstrap"),
 		Code:    awslambda.Code_FromAsset(jsii.String("dist/lambda/blog.zip"), nil),
 		Environment: &map[string]*string{
-			"POSTS_BUCKET": bucket.BucketName(),
+			"POSTS_BUCKET":    bucket.BucketName(),
+			"WRITE_QUEUE_URL": writeQueue.QueueUrl(),
 		},
 	})
 	bucket.GrantReadWrite(fn, nil)
+	writeQueue.GrantSendMessages(fn)
+
+	// 添付ファイル(attachments/配下)への署名付きURL発行に必要な最小権限
+	fn.AddToRolePolicy(awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+		Actions:   jsii.Strings("s3:GetObject", "s3:PutObject"),
+		Resources: jsii.Strings(*bucket.ArnForObjects(jsii.String("attachments/*"))),
+	}))
+
+	// Lambda: SQSを消費して記事の書き込みをS3へ反映するワーカー
+	workerFn := awslambda.NewFunction(stack, jsii.String("BlogWorker"), &awslambda.FunctionProps{
+		Runtime: awslambda.Runtime_PROVIDED_AL2(),
+		Handler: jsii.String("bootstrap"),
+		Code:    awslambda.Code_FromAsset(jsii.String("dist/lambda/worker.zip"), nil),
+		Environment: &map[string]*string{
+			"POSTS_BUCKET": bucket.BucketName(),
+		},
+	})
+	bucket.GrantReadWrite(workerFn, nil)
+	writeQueue.GrantConsumeMessages(workerFn)
+	workerFn.AddEventSource(awslambdaeventsources.NewSqsEventSource(writeQueue, &awslambdaeventsources.SqsEventSourceProps{
+		BatchSize:               jsii.Number(10),
+		ReportBatchItemFailures: jsii.Bool(true),
+	}))
 
 	// API Gateway: /posts, /posts/{id}
 	api := awsapigateway.NewLambdaRestApi(stack, jsii.String("BlogApiGateway"), &awsapigateway.LambdaRestApiProps{
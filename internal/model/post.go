@@ -4,16 +4,18 @@ import "time"
 
 // ブログ記事のデータモデル
 type Post struct {
-  ID        int       `json:"id"`
-	Title     string    `json:"title"`
-	Content   string    `json:"content"`
-	CreatedAt time.Time `json:"created_at"`
-  UpdatedAt time.Time `json:"updated_at"`
+	ID          int          `json:"id"`
+	Title       string       `json:"title"`
+	Content     string       `json:"content"`
+	Tags        []string     `json:"tags,omitempty"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
 }
 
 // 記事作成・更新リクエスト
 type PostRequest struct {
-  Title   string `json:"title"`
+	Title   string `json:"title"`
 	Content string `json:"content"`
 }
 
@@ -22,3 +24,20 @@ type PostListResponse struct {
 	Posts []Post `json:"posts"`
 	Total int    `json:"total"`
 }
+
+// 記事に添付されたバイナリファイルのメタデータ
+type Attachment struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+}
+
+// 添付ファイル登録リクエスト
+type AttachmentRequest struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+}
+
+// 署名付きURLレスポンス
+type PresignedURLResponse struct {
+	URL string `json:"url"`
+}
@@ -0,0 +1,106 @@
+// Package errs はS3操作から返るエラーを分類し、呼び出し側が扱いやすい
+// センチネルエラーへ変換するための型を提供する。
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	smithy "github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// エラーの分類
+type Kind int
+
+const (
+	KindUnknown Kind = iota
+	KindNotFound
+	KindConflict
+	KindThrottled
+	KindTransient
+	KindPermanent
+)
+
+// 分類ごとのセンチネルエラー
+var (
+	ErrNotFound  = errors.New("not found")
+	ErrConflict  = errors.New("conflict")
+	ErrThrottled = errors.New("throttled")
+	ErrTransient = errors.New("transient error")
+	ErrPermanent = errors.New("permanent error")
+)
+
+// Sentinel はKindに対応するセンチネルエラーを返す
+func (k Kind) Sentinel() error {
+	switch k {
+	case KindNotFound:
+		return ErrNotFound
+	case KindConflict:
+		return ErrConflict
+	case KindThrottled:
+		return ErrThrottled
+	case KindTransient:
+		return ErrTransient
+	default:
+		return ErrPermanent
+	}
+}
+
+// Retryable はこの分類のエラーをリトライすべきかどうかを返す
+func (k Kind) Retryable() bool {
+	return k == KindThrottled || k == KindTransient
+}
+
+// Classify はsmithy.APIError/types.NoSuchKey/HTTPステータスなどを手がかりに
+// errの根本原因を調べてKindへ分類する
+func Classify(err error) Kind {
+	if err == nil {
+		return KindUnknown
+	}
+
+	var noSuchKey *types.NoSuchKey
+	var noSuchBucket *types.NoSuchBucket
+	if errors.As(err, &noSuchKey) || errors.As(err, &noSuchBucket) {
+		return KindNotFound
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "NoSuchKey", "NoSuchBucket", "NotFound":
+			return KindNotFound
+		case "Throttling", "ThrottlingException", "SlowDown", "RequestLimitExceeded", "TooManyRequestsException":
+			return KindThrottled
+		case "PreconditionFailed", "ConditionalRequestConflict":
+			return KindConflict
+		}
+	}
+
+	var respErr *smithyhttp.ResponseError
+	if errors.As(err, &respErr) {
+		switch respErr.HTTPStatusCode() {
+		case http.StatusNotFound:
+			return KindNotFound
+		case http.StatusConflict:
+			return KindConflict
+		case http.StatusTooManyRequests:
+			return KindThrottled
+		}
+		if respErr.HTTPStatusCode() >= http.StatusInternalServerError {
+			return KindTransient
+		}
+	}
+
+	return KindPermanent
+}
+
+// Wrap はerrをClassifyの結果に応じたセンチネルエラーでラップする
+func Wrap(err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("%w: %v", Classify(err).Sentinel(), err)
+}
@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"os"
+	"strconv"
+)
+
+// 環境変数からNewS3Repository向けのOptionを組み立てる
+// 値が未設定または不正な場合はそのオプションを適用せず、デフォルト値を使わせる
+func OptionsFromEnv() []Option {
+	var opts []Option
+
+	if v, ok := os.LookupEnv("S3_UPLOAD_PART_SIZE"); ok {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			opts = append(opts, WithPartSize(n))
+		}
+	}
+
+	if v, ok := os.LookupEnv("S3_UPLOAD_CONCURRENCY"); ok {
+		if n, err := strconv.Atoi(v); err == nil {
+			opts = append(opts, WithConcurrency(n))
+		}
+	}
+
+	if v, ok := os.LookupEnv("S3_MULTIPART_THRESHOLD"); ok {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			opts = append(opts, WithMultipartThreshold(n))
+		}
+	}
+
+	if v, ok := os.LookupEnv("S3_MD5_CHECK"); ok {
+		if b, err := strconv.ParseBool(v); err == nil {
+			opts = append(opts, WithMD5Check(b))
+		}
+	}
+
+	return opts
+}
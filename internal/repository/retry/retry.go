@@ -0,0 +1,58 @@
+// Package retry はS3呼び出し向けのジッター付き指数バックオフリトライを提供する。
+package retry
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"lambda/internal/repository/errs"
+)
+
+// バックオフのポリシー
+type Policy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// DefaultPolicy はS3呼び出しで用いるデフォルトのリトライポリシー
+var DefaultPolicy = Policy{
+	MaxAttempts: 3,
+	BaseDelay:   100 * time.Millisecond,
+	MaxDelay:    2 * time.Second,
+}
+
+// Do はopをpolicyに従って実行し、リトライ可能なエラーの間はジッター付き
+// 指数バックオフを挟んで再試行する。リトライ不能なエラーは即座に返す
+func Do(ctx context.Context, op func(ctx context.Context) error, policy Policy) error {
+	var err error
+	for attempt := 0; attempt < policy.MaxAttempts; attempt++ {
+		err = op(ctx)
+		if err == nil {
+			return nil
+		}
+		if !errs.Classify(err).Retryable() {
+			return err
+		}
+		if attempt == policy.MaxAttempts-1 {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff(policy, attempt)):
+		}
+	}
+	return err
+}
+
+// backoff は試行回数に応じた指数バックオフにジッターを加えた待機時間を計算する
+func backoff(policy Policy, attempt int) time.Duration {
+	d := policy.BaseDelay << attempt
+	if d > policy.MaxDelay || d <= 0 {
+		d = policy.MaxDelay
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
@@ -3,63 +3,182 @@ package repository
 import (
 	"bytes"
 	"context"
+	"crypto/md5"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"strconv"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 
 	"lambda/internal/model"
+	"lambda/internal/repository/errs"
+	"lambda/internal/repository/retry"
 	"lambda/pkg/logger"
 )
 
+// マルチパートアップロードに切り替える本文サイズのしきい値(デフォルト8MiB)
+const defaultMultipartThreshold = 8 * 1024 * 1024
+
 // S3ベースの記事リポジトリ
 type S3Repository struct {
-	client *s3.Client
-	bucket string
+	client             *s3.Client
+	presignClient      *s3.PresignClient
+	uploader           *S3Uploader
+	downloader         *manager.Downloader
+	multipartThreshold int64
+	md5Check           bool
+	bucket             string
+}
+
+// NewS3Repositoryのオプション
+type Option func(*options)
+
+type options struct {
+	partSize           int64
+	concurrency        int
+	md5Check           bool
+	multipartThreshold int64
+}
+
+// マルチパートアップロードのパートサイズを指定する
+func WithPartSize(size int64) Option {
+	return func(o *options) { o.partSize = size }
+}
+
+// マルチパートアップロードの並列数を指定する
+func WithConcurrency(n int) Option {
+	return func(o *options) { o.concurrency = n }
+}
+
+// アップロード時にContentMD5を検証するか指定する
+func WithMD5Check(enabled bool) Option {
+	return func(o *options) { o.md5Check = enabled }
+}
+
+// マルチパートアップロードに切り替える本文サイズのしきい値を指定する
+func WithMultipartThreshold(threshold int64) Option {
+	return func(o *options) { o.multipartThreshold = threshold }
 }
 
 // S3リポジトリのコンストラクタ
-func NewS3Repository(bucket string) (*S3Repository, error) {
+func NewS3Repository(bucket string, opts ...Option) (*S3Repository, error) {
 	cfg, err := config.LoadDefaultConfig(context.Background())
 	if err != nil {
 		return nil, fmt.Errorf("failed to load AWS config: %w", err)
 	}
 
+	o := &options{
+		partSize:           manager.DefaultUploadPartSize,
+		concurrency:        manager.DefaultUploadConcurrency,
+		multipartThreshold: defaultMultipartThreshold,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	client := s3.NewFromConfig(cfg)
+
 	return &S3Repository{
-		client: s3.NewFromConfig(cfg),
-		bucket: bucket,
+		client:             client,
+		presignClient:      s3.NewPresignClient(client),
+		uploader:           NewS3Uploader(client, o.partSize, o.concurrency, o.md5Check),
+		downloader:         manager.NewDownloader(client),
+		multipartThreshold: o.multipartThreshold,
+		md5Check:           o.md5Check,
+		bucket:             bucket,
 	}, nil
 }
 
-// 404エラーの判定
-func isNotFoundError(err error) bool {
-	var notFound *types.NoSuchKey
-	return err != nil && errors.As(err, &notFound)
+// 添付ファイルの格納キーを組み立てる
+func AttachmentKey(postID int, name string) string {
+	return fmt.Sprintf("attachments/%d/%s", postID, name)
 }
 
-// S3キーから記事を取得
-func (r *S3Repository) getPostByKey(ctx context.Context, key string) (*model.Post, error) {
-	out, err := r.client.GetObject(ctx, &s3.GetObjectInput){
-		Bucket: &r.bucket,
-		Key:    &key,
+// S3オブジェクトタグのキーに付与するプレフィックス
+const tagKeyPrefix = "tag:"
+
+// タグ一覧をS3オブジェクトタグに変換する
+func tagsToTagSet(tags []string) []types.Tag {
+	tagSet := make([]types.Tag, 0, len(tags))
+	for _, tag := range tags {
+		key := tagKeyPrefix + tag
+		value := "true"
+		tagSet = append(tagSet, types.Tag{Key: &key, Value: &value})
 	}
-	if err != nil {
-		if isNotFoundError(err) {
-			return nil, fmt.Errorf("post not found")
+	return tagSet
+}
+
+// S3オブジェクトタグからタグ一覧を復元する
+func tagSetToTags(tagSet []types.Tag) []string {
+	tags := make([]string, 0, len(tagSet))
+	for _, t := range tagSet {
+		if t.Key != nil && strings.HasPrefix(*t.Key, tagKeyPrefix) {
+			tags = append(tags, strings.TrimPrefix(*t.Key, tagKeyPrefix))
 		}
-		return nil, fmt.Errorf("failed to get post: %w", err)
 	}
-	defer out.Body.Close()
+	return tags
+}
 
-	body, err := io.ReadAll(out.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read post body: %w", err)
+// S3キーから記事を取得
+// サイズが事前にわかっていない場合は-1を渡す。その場合はGetObjectを直接発行し、
+// 余分なHeadObjectを挟まずにそのレスポンスのContentLengthだけでDownloaderへの
+// フォールバック要否を判断する
+func (r *S3Repository) getPostByKey(ctx context.Context, key string) (*model.Post, error) {
+	return r.getPostByKeySized(ctx, key, -1)
+}
+
+// サイズが既知の場合(ListObjectsV2のSizeなど)はHeadObject/GetObjectを介した
+// サイズ判定自体を省略し、直接Downloader/GetObjectを使い分ける
+func (r *S3Repository) getPostByKeySized(ctx context.Context, key string, knownSize int64) (*model.Post, error) {
+	var body []byte
+
+	if knownSize > r.multipartThreshold {
+		b, err := r.downloadPost(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		body = b
+	} else {
+		var out *s3.GetObjectOutput
+		err := retry.Do(ctx, func(ctx context.Context) error {
+			o, err := r.client.GetObject(ctx, &s3.GetObjectInput{
+				Bucket: &r.bucket,
+				Key:    &key,
+			})
+			if err != nil {
+				return err
+			}
+			out = o
+			return nil
+		}, retry.DefaultPolicy)
+		if err != nil {
+			return nil, errs.Wrap(err)
+		}
+
+		if knownSize < 0 && out.ContentLength != nil && *out.ContentLength > r.multipartThreshold {
+			// サイズが未知のまま取得したら実際には大きかったので、
+			// ストリーミング取得にフォールバックする
+			out.Body.Close()
+			b, err := r.downloadPost(ctx, key)
+			if err != nil {
+				return nil, err
+			}
+			body = b
+		} else {
+			b, err := io.ReadAll(out.Body)
+			out.Body.Close()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read post body: %w", err)
+			}
+			body = b
+		}
 	}
 
 	var post model.Post
@@ -70,6 +189,17 @@ func (r *S3Repository) getPostByKey(ctx context.Context, key string) (*model.Pos
 	return &post, nil
 }
 
+// Downloaderによるストリーミング取得で本文を読み出す
+func (r *S3Repository) downloadPost(ctx context.Context, key string) ([]byte, error) {
+	buf := manager.NewWriteAtBuffer([]byte{})
+	if _, err := r.downloader.Download(ctx, buf, &s3.GetObjectInput{
+		Bucket: &r.bucket,
+		Key:    &key,
+	}); err != nil {
+		return nil, errs.Wrap(err)
+	}
+	return buf.Bytes(), nil
+}
 
 // 記事をS3に保存
 func (r *S3Repository) savePost(ctx context.Context, key string, post *model.Post) error {
@@ -79,15 +209,64 @@ func (r *S3Repository) savePost(ctx context.Context, key string, post *model.Pos
 	}
 
 	contentType := "application/json"
-	_, err = r.client.PutObject(ctx, &s3.PutObjectInput{
-		Bucket:      &r.bucket,
-		Key:         &key,
-		Body:        bytes.NewReader(body),
-		ContentType: &contentType,
-	})
-	if err != nil {
-		logger.Error("failed to save post", "key", key, "error", err)
-		return fmt.Errorf("failed to save post: %w", err)
+	if int64(len(body)) > r.multipartThreshold {
+		if err := r.uploader.Upload(ctx, r.bucket, key, contentType, body); err != nil {
+			logger.Error("failed to upload large post", "key", key, "error", err)
+			return errs.Wrap(err)
+		}
+	} else {
+		input := &s3.PutObjectInput{
+			Bucket:      &r.bucket,
+			Key:         &key,
+			Body:        bytes.NewReader(body),
+			ContentType: &contentType,
+		}
+		if r.md5Check {
+			// PutObjectによる単一アップロードではContent-MD5をS3が検証するため、
+			// マルチパートと異なりここではそのまま指定して整合性を担保できる
+			sum := md5.Sum(body)
+			digest := base64.StdEncoding.EncodeToString(sum[:])
+			input.ContentMD5 = &digest
+		}
+
+		err := retry.Do(ctx, func(ctx context.Context) error {
+			input.Body = bytes.NewReader(body)
+			_, err := r.client.PutObject(ctx, input)
+			return err
+		}, retry.DefaultPolicy)
+		if err != nil {
+			logger.Error("failed to save post", "key", key, "error", err)
+			return errs.Wrap(err)
+		}
+	}
+
+	// タグは保存のたびに完全な状態へ合わせる。空の場合も含めて必ず反映しないと、
+	// 古いタグがS3に残り続けてListPostsByTagが更新/削除後も古いタグで記事を返してしまう
+	if len(post.Tags) > 0 {
+		err := retry.Do(ctx, func(ctx context.Context) error {
+			_, err := r.client.PutObjectTagging(ctx, &s3.PutObjectTaggingInput{
+				Bucket:  &r.bucket,
+				Key:     &key,
+				Tagging: &types.Tagging{TagSet: tagsToTagSet(post.Tags)},
+			})
+			return err
+		}, retry.DefaultPolicy)
+		if err != nil {
+			logger.Error("failed to tag post", "key", key, "error", err)
+			return errs.Wrap(err)
+		}
+	} else {
+		err := retry.Do(ctx, func(ctx context.Context) error {
+			_, err := r.client.DeleteObjectTagging(ctx, &s3.DeleteObjectTaggingInput{
+				Bucket: &r.bucket,
+				Key:    &key,
+			})
+			return err
+		}, retry.DefaultPolicy)
+		if err != nil {
+			logger.Error("failed to clear post tags", "key", key, "error", err)
+			return errs.Wrap(err)
+		}
 	}
 
 	logger.Info("successfully saved post", "key", key)
@@ -99,22 +278,35 @@ func (r *S3Repository) ListPosts(ctx context.Context) ([]model.Post, error) {
 	logger.Info("listing posts from S3", "bucket", r.bucket)
 
 	prefix := "posts/"
-	out, err := r.client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
-		Bucket: &r.bucket,
-    Prefix: &prefix,
-	})
+	var out *s3.ListObjectsV2Output
+	err := retry.Do(ctx, func(ctx context.Context) error {
+		o, err := r.client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket: &r.bucket,
+			Prefix: &prefix,
+		})
+		if err != nil {
+			return err
+		}
+		out = o
+		return nil
+	}, retry.DefaultPolicy)
 	if err != nil {
 		logger.Error("failed to list objects", "error", err)
-		return nil, fmt.Errorf("failed to list posts: %w", err)
+		return nil, errs.Wrap(err)
 	}
 
 	posts := make([]model.Post, 0, len(out.Contents))
 	for _, obj := range out.Contents {
-    if !strings.HasSuffix(*obj.Key, ".json") {
+		if !strings.HasSuffix(*obj.Key, ".json") {
 			continue
 		}
 
-		post, err := r.getPostByKey(ctx, *obj.Key)
+		size := int64(0)
+		if obj.Size != nil {
+			size = *obj.Size
+		}
+
+		post, err := r.getPostByKeySized(ctx, *obj.Key, size)
 		if err != nil {
 			logger.Error("failed to get post", "key", *obj.Key, "error", err)
 			continue
@@ -126,6 +318,82 @@ func (r *S3Repository) ListPosts(ctx context.Context) ([]model.Post, error) {
 	return posts, nil
 }
 
+// 指定タグが付与された記事一覧を取得
+// GetObjectTaggingで(key, tags)を先に集め、タグが一致したオブジェクトのみ本文を取得する
+func (r *S3Repository) ListPostsByTag(ctx context.Context, tag string) ([]model.Post, error) {
+	logger.Info("listing posts by tag from S3", "tag", tag, "bucket", r.bucket)
+
+	prefix := "posts/"
+	var out *s3.ListObjectsV2Output
+	err := retry.Do(ctx, func(ctx context.Context) error {
+		o, err := r.client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket: &r.bucket,
+			Prefix: &prefix,
+		})
+		if err != nil {
+			return err
+		}
+		out = o
+		return nil
+	}, retry.DefaultPolicy)
+	if err != nil {
+		logger.Error("failed to list objects", "error", err)
+		return nil, errs.Wrap(err)
+	}
+
+	type matchedObject struct {
+		key  string
+		size int64
+	}
+	matched := make([]matchedObject, 0)
+	for _, obj := range out.Contents {
+		if !strings.HasSuffix(*obj.Key, ".json") {
+			continue
+		}
+
+		var tagOut *s3.GetObjectTaggingOutput
+		err := retry.Do(ctx, func(ctx context.Context) error {
+			o, err := r.client.GetObjectTagging(ctx, &s3.GetObjectTaggingInput{
+				Bucket: &r.bucket,
+				Key:    obj.Key,
+			})
+			if err != nil {
+				return err
+			}
+			tagOut = o
+			return nil
+		}, retry.DefaultPolicy)
+		if err != nil {
+			logger.Error("failed to get object tagging", "key", *obj.Key, "error", err)
+			continue
+		}
+
+		for _, t := range tagSetToTags(tagOut.TagSet) {
+			if t == tag {
+				size := int64(0)
+				if obj.Size != nil {
+					size = *obj.Size
+				}
+				matched = append(matched, matchedObject{key: *obj.Key, size: size})
+				break
+			}
+		}
+	}
+
+	posts := make([]model.Post, 0, len(matched))
+	for _, m := range matched {
+		post, err := r.getPostByKeySized(ctx, m.key, m.size)
+		if err != nil {
+			logger.Error("failed to get post", "key", m.key, "error", err)
+			continue
+		}
+		posts = append(posts, *post)
+	}
+
+	logger.Info("successfully listed posts by tag", "tag", tag, "count", len(posts))
+	return posts, nil
+}
+
 // 指定IDの記事を取得
 func (r *S3Repository) GetPost(ctx context.Context, id int) (*model.Post, error) {
 	logger.Info("getting post from S3", "id", id, "bucket", r.bucket)
@@ -148,21 +416,81 @@ func (r *S3Repository) UpdatePost(ctx context.Context, id int, post *model.Post)
 
 	key := fmt.Sprintf("posts/%d.json", id)
 	post.ID = id // URLのIDを優先
+
+	// Attachments・CreatedAtはどちらもクライアントのPUTボディが管理するものではなく、
+	// サーバー側(Attachmentsは AppendAttachment、CreatedAtは作成時点)で決まるフィールド。
+	// 既存オブジェクトがある場合はクライアントが送ってきた値を使わず、その値で上書きする。
+	// 既存オブジェクトがない場合はクライアントの値がそのまま保存される
+	existing, err := r.getPostByKey(ctx, key)
+	if err != nil && !errors.Is(err, errs.ErrNotFound) {
+		return err
+	}
+	if existing != nil {
+		post.Attachments = existing.Attachments
+		post.CreatedAt = existing.CreatedAt
+	}
+
 	return r.savePost(ctx, key, post)
 }
 
-// 記事を削除
-func (r *S3Repository) DeletePost(ctx context.Context, id int) error {
-	logger.Info("deleting post from S3", "id", id)
+// AppendAttachment は既存の記事を読み直し、添付ファイルのメタデータを追記して保存する
+// UpdatePostは既存記事のAttachmentsを保持するため、既存記事への添付ファイル追記はこの経路で行う。
+// なおCreatePostはリクエスト本文のAttachmentsをそのまま保存する
+func (r *S3Repository) AppendAttachment(ctx context.Context, id int, attachment model.Attachment) error {
+	post, err := r.GetPost(ctx, id)
+	if err != nil {
+		return err
+	}
 
+	post.Attachments = append(post.Attachments, attachment)
+	post.UpdatedAt = time.Now()
 
 	key := fmt.Sprintf("posts/%d.json", id)
-	_, err := r.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+	return r.savePost(ctx, key, post)
+}
+
+// 添付ファイルダウンロード用の期限付きURLを発行
+func (r *S3Repository) PresignGet(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	out, err := r.presignClient.PresignGetObject(ctx, &s3.GetObjectInput{
 		Bucket: &r.bucket,
 		Key:    &key,
-	})
+	}, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", errs.Wrap(err)
+	}
+
+	return out.URL, nil
+}
+
+// 添付ファイルアップロード用の期限付きURLを発行
+func (r *S3Repository) PresignPut(ctx context.Context, key, contentType string, ttl time.Duration) (string, error) {
+	out, err := r.presignClient.PresignPutObject(ctx, &s3.PutObjectInput{
+		Bucket:      &r.bucket,
+		Key:         &key,
+		ContentType: &contentType,
+	}, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", errs.Wrap(err)
+	}
+
+	return out.URL, nil
+}
+
+// 記事を削除
+func (r *S3Repository) DeletePost(ctx context.Context, id int) error {
+	logger.Info("deleting post from S3", "id", id)
+
+	key := fmt.Sprintf("posts/%d.json", id)
+	err := retry.Do(ctx, func(ctx context.Context) error {
+		_, err := r.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: &r.bucket,
+			Key:    &key,
+		})
+		return err
+	}, retry.DefaultPolicy)
 	if err != nil {
 		logger.Error("failed to delete post", "id", id, "error", err)
+		return errs.Wrap(err)
 	}
 
 	logger.Info("successfully deleted post", "id", id)
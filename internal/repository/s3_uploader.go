@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// マルチパートアップロードでS3へ保存するアップローダー
+type S3Uploader struct {
+	uploader *manager.Uploader
+	md5Check bool
+}
+
+// S3Uploaderのコンストラクタ
+func NewS3Uploader(client *s3.Client, partSize int64, concurrency int, md5Check bool) *S3Uploader {
+	uploader := manager.NewUploader(client, func(u *manager.Uploader) {
+		u.PartSize = partSize
+		u.Concurrency = concurrency
+	})
+
+	return &S3Uploader{
+		uploader: uploader,
+		md5Check: md5Check,
+	}
+}
+
+// 本文をマルチパートでアップロードする
+func (u *S3Uploader) Upload(ctx context.Context, bucket, key, contentType string, body []byte) error {
+	input := &s3.PutObjectInput{
+		Bucket:      &bucket,
+		Key:         &key,
+		Body:        bytes.NewReader(body),
+		ContentType: &contentType,
+	}
+
+	if u.md5Check {
+		// マルチパートアップロードでは全体に対するContent-MD5はS3に検証されないため、
+		// SDKがパートごとに計算・検証するチェックサムアルゴリズムを指定する
+		input.ChecksumAlgorithm = types.ChecksumAlgorithmSha256
+	}
+
+	if _, err := u.uploader.Upload(ctx, input); err != nil {
+		return fmt.Errorf("failed to upload object: %w", err)
+	}
+
+	return nil
+}
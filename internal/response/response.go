@@ -2,9 +2,12 @@ package response
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/aws/aws-lambda-go/events"
+
+	"lambda/internal/repository/errs"
 )
 
 // 成功レスポンスを生成
@@ -37,6 +40,21 @@ func Created(data interface{}) events.APIGatewayProxyResponse {
 	}
 }
 
+// 受理レスポンス(非同期処理の202 Accepted)
+func Accepted(data interface{}) events.APIGatewayProxyResponse {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, "failed to marshal response")
+	}
+	return events.APIGatewayProxyResponse{
+		StatusCode: http.StatusAccepted,
+		Body:       string(body),
+		Headers: map[string]string{
+			"Content-Type": "application/json",
+		},
+	}
+}
+
 // 削除成功レスポンス
 func NoContent() events.APIGatewayProxyResponse {
 	return events.APIGatewayProxyResponse{
@@ -82,3 +100,35 @@ func NotFound(message string) events.APIGatewayProxyResponse {
 func InternalServerError(message string) events.APIGatewayProxyResponse {
 	return errorResponse(http.StatusInternalServerError, message)
 }
+
+// FromError はerrs.Classifyの分類に応じて適切なHTTPレスポンスへ変換する
+func FromError(err error) events.APIGatewayProxyResponse {
+	switch {
+	case errors.Is(err, errs.ErrNotFound):
+		return NotFound(err.Error())
+	case errors.Is(err, errs.ErrConflict):
+		return errorResponse(http.StatusConflict, err.Error())
+	case errors.Is(err, errs.ErrThrottled):
+		return throttled(err.Error())
+	case errors.Is(err, errs.ErrTransient):
+		return errorResponse(http.StatusServiceUnavailable, err.Error())
+	default:
+		return InternalServerError(err.Error())
+	}
+}
+
+// スロットリングエラー(429, Retry-After付き)
+func throttled(message string) events.APIGatewayProxyResponse {
+	body, err := json.Marshal(map[string]string{"error": message})
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, "failed to marshal error response")
+	}
+	return events.APIGatewayProxyResponse{
+		StatusCode: http.StatusTooManyRequests,
+		Body:       string(body),
+		Headers: map[string]string{
+			"Content-Type": "application/json",
+			"Retry-After":  "1",
+		},
+	}
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+
+	"lambda/internal/model"
+	"lambda/pkg/logger"
+)
+
+// SQSへ書き込みリクエストを積む非同期PostService実装
+// 実際の反映はワーカーLambda(lambda/cmd/worker)がキューを消費して行う
+type AsyncPostService struct {
+	client   *sqs.Client
+	queueURL string
+}
+
+// AsyncPostServiceのコンストラクタ
+func NewAsyncPostService(queueURL string) (*AsyncPostService, error) {
+	cfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	return &AsyncPostService{
+		client:   sqs.NewFromConfig(cfg),
+		queueURL: queueURL,
+	}, nil
+}
+
+func (s *AsyncPostService) CreatePost(ctx context.Context, post *model.Post) error {
+	return s.enqueue(ctx, OpCreate, post.ID, post)
+}
+
+func (s *AsyncPostService) UpdatePost(ctx context.Context, id int, post *model.Post) error {
+	post.ID = id
+	return s.enqueue(ctx, OpUpdate, id, post)
+}
+
+func (s *AsyncPostService) DeletePost(ctx context.Context, id int) error {
+	return s.enqueue(ctx, OpDelete, id, nil)
+}
+
+// AddAttachment は添付ファイルのメタデータ追記をSQSへ積む
+// 実際の読み直し・追記はワーカーが同じMessageGroupId上で行うため、
+// create/update/deleteと順序が競合することはない
+func (s *AsyncPostService) AddAttachment(ctx context.Context, id int, attachment model.Attachment) error {
+	return s.enqueue(ctx, OpAddAttachment, id, attachment)
+}
+
+// 書き込みリクエストをJSONエンベロープとしてSQSへ送信する
+func (s *AsyncPostService) enqueue(ctx context.Context, op Operation, id int, payload interface{}) error {
+	var raw json.RawMessage
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to marshal payload: %w", err)
+		}
+		raw = b
+	}
+
+	body, err := json.Marshal(Envelope{Op: op, ID: id, Payload: raw})
+	if err != nil {
+		return fmt.Errorf("failed to marshal envelope: %w", err)
+	}
+	bodyStr := string(body)
+
+	input := &sqs.SendMessageInput{
+		QueueUrl:    &s.queueURL,
+		MessageBody: &bodyStr,
+	}
+	if strings.HasSuffix(s.queueURL, ".fifo") {
+		dedupID := deduplicationID(op, id, raw)
+		groupID := fmt.Sprintf("post-%d", id)
+		input.MessageDeduplicationId = &dedupID
+		input.MessageGroupId = &groupID
+	}
+
+	if _, err := s.client.SendMessage(ctx, input); err != nil {
+		logger.Error("failed to enqueue post mutation", "op", op, "id", id, "error", err)
+		return fmt.Errorf("failed to enqueue post mutation: %w", err)
+	}
+
+	logger.Info("enqueued post mutation", "op", op, "id", id)
+	return nil
+}
+
+// MessageDeduplicationId用の決定的なIDを計算する(sha256(op|id|payload))
+func deduplicationID(op Operation, id int, payload []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s|%d|", op, id)
+	h.Write(payload)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,20 @@
+package service
+
+import "encoding/json"
+
+// 非同期書き込みリクエストの種類
+type Operation string
+
+const (
+	OpCreate        Operation = "create"
+	OpUpdate        Operation = "update"
+	OpDelete        Operation = "delete"
+	OpAddAttachment Operation = "add_attachment"
+)
+
+// SQSに送信する非同期書き込みリクエストのエンベロープ
+type Envelope struct {
+	Op      Operation       `json:"op"`
+	ID      int             `json:"id"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
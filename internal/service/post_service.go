@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+
+	"lambda/internal/model"
+	"lambda/internal/repository"
+)
+
+// 記事の作成・更新・削除・添付ファイル登録を行うサービス
+// 同期実装(SyncPostService)と非同期実装(AsyncPostService)を切り替えて使う
+type PostService interface {
+	CreatePost(ctx context.Context, post *model.Post) error
+	UpdatePost(ctx context.Context, id int, post *model.Post) error
+	DeletePost(ctx context.Context, id int) error
+	AddAttachment(ctx context.Context, id int, attachment model.Attachment) error
+}
+
+// S3Repositoryへ同期的に書き込むPostService実装(従来の挙動)
+type SyncPostService struct {
+	repo *repository.S3Repository
+}
+
+// SyncPostServiceのコンストラクタ
+func NewSyncPostService(repo *repository.S3Repository) *SyncPostService {
+	return &SyncPostService{repo: repo}
+}
+
+func (s *SyncPostService) CreatePost(ctx context.Context, post *model.Post) error {
+	return s.repo.CreatePost(ctx, post)
+}
+
+func (s *SyncPostService) UpdatePost(ctx context.Context, id int, post *model.Post) error {
+	return s.repo.UpdatePost(ctx, id, post)
+}
+
+func (s *SyncPostService) DeletePost(ctx context.Context, id int) error {
+	return s.repo.DeletePost(ctx, id)
+}
+
+// AddAttachment は記事に添付ファイルのメタデータを追記する
+func (s *SyncPostService) AddAttachment(ctx context.Context, id int, attachment model.Attachment) error {
+	return s.repo.AppendAttachment(ctx, id, attachment)
+}
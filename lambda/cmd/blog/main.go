@@ -1,131 +1,219 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
-	"fmt"
-	"io"
 	"net/http"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"lambda/internal/model"
+	"lambda/internal/repository"
+	"lambda/internal/response"
+	"lambda/internal/service"
+	"lambda/pkg/logger"
 )
 
-type Post struct {
-	ID      int    `json:"id"`
-	Title   string `json:"title"`
-	Content string `json:"content"`
-}
+// 添付ファイル署名付きURLの有効期限
+const presignTTL = 15 * time.Minute
 
 var (
-	s3Client *s3.Client
-	bucket   string
+	repo  *repository.S3Repository
+	svc   service.PostService
+	async bool
 )
 
 func init() {
-	bucket = os.Getenv("POSTS_BUCKET")
-	cfg, _ := config.LoadDefaultConfig(context.Background())
-	s3Client = s3.NewFromConfig(cfg)
-}
+	bucket := os.Getenv("POSTS_BUCKET")
 
-func jsonOK(v interface{}) events.APIGatewayProxyResponse {
-	b, _ := json.Marshal(v)
-	return events.APIGatewayProxyResponse{StatusCode: 200, Body: string(b), Headers: map[string]string{"Content-Type": "application/json"}}
-}
+	r, err := repository.NewS3Repository(bucket, repository.OptionsFromEnv()...)
+	if err != nil {
+		logger.Error("failed to initialize repository", "error", err)
+		os.Exit(1)
+	}
+	repo = r
 
-func errorJSON(code int, msg string) (events.APIGatewayProxyResponse, error) {
-	b, _ := json.Marshal(map[string]string{"error": msg})
-	return events.APIGatewayProxyResponse{StatusCode: code, Body: string(b), Headers: map[string]string{"Content-Type": "application/json"}}, nil
+	if queueURL := os.Getenv("WRITE_QUEUE_URL"); queueURL != "" {
+		asyncSvc, err := service.NewAsyncPostService(queueURL)
+		if err != nil {
+			logger.Error("failed to initialize async post service", "error", err)
+			os.Exit(1)
+		}
+		svc = asyncSvc
+		async = true
+	} else {
+		svc = service.NewSyncPostService(repo)
+	}
 }
 
 func handle(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	path := req.Path
 	method := req.HTTPMethod
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	switch {
+	case method == http.MethodGet && len(segments) == 1 && segments[0] == "posts":
+		return listPosts(ctx, req.QueryStringParameters["tag"])
+	case method == http.MethodPost && len(segments) == 1 && segments[0] == "posts":
+		return createPost(ctx, req.Body)
+	case method == http.MethodGet && len(segments) == 2 && segments[0] == "posts":
+		return getPost(ctx, segments[1])
+	case method == http.MethodPut && len(segments) == 2 && segments[0] == "posts":
+		return updatePost(ctx, segments[1], req.Body)
+	case method == http.MethodDelete && len(segments) == 2 && segments[0] == "posts":
+		return deletePost(ctx, segments[1])
+	case method == http.MethodPost && len(segments) == 3 && segments[0] == "posts" && segments[2] == "attachments":
+		return createAttachment(ctx, segments[1], req.Body)
+	case method == http.MethodGet && len(segments) == 4 && segments[0] == "posts" && segments[2] == "attachments":
+		return getAttachment(ctx, segments[1], segments[3])
+	}
 
-	if method == http.MethodGet && path == "/posts" {
-		// 一覧
-		prefix := "posts/"
-		out, err := s3Client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{Bucket: &bucket, Prefix: &prefix})
-		if err != nil {
-			return errorJSON(500, "list failed")
-		}
+	return response.NotFound("not found"), nil
+}
 
-		posts := make([]Post, 0)
-		for _, obj := range out.Contents {
-			key := *obj.Key
-			if !strings.HasSuffix(key, ".json") {
-				continue
-			}
-
-			po, err := s3Client.GetObject(ctx, &s3.GetObjectInput{Bucket: &bucket, Key: &key})
-			if err != nil {
-				continue
-			}
-
-			var p Post
-			b, _ := io.ReadAll(po.Body)
-			_ = po.Body.Close()
-			if json.Unmarshal(b, &p) == nil {
-				posts = append(posts, p)
-			}
-		}
-		return jsonOK(posts), nil
+func listPosts(ctx context.Context, tag string) (events.APIGatewayProxyResponse, error) {
+	var (
+		posts []model.Post
+		err   error
+	)
+	if tag != "" {
+		posts, err = repo.ListPostsByTag(ctx, tag)
+	} else {
+		posts, err = repo.ListPosts(ctx)
+	}
+	if err != nil {
+		return response.FromError(err), nil
 	}
 
-	if method == http.MethodGet && strings.HasPrefix(path, "/posts/") {
-		idStr := strings.TrimPrefix(path, "/posts/")
-		id, err := strconv.Atoi(idStr)
-		if err != nil {
-			return errorJSON(400, "invalid id: must be a number")
-		}
-		key := fmt.Sprintf("posts/%d.json", id)
-		po, err := s3Client.GetObject(ctx, &s3.GetObjectInput{Bucket: &bucket, Key: &key})
-		if err != nil {
-			return errorJSON(404, "not found")
-		}
+	return response.Success(model.PostListResponse{Posts: posts, Total: len(posts)}), nil
+}
 
-		b, _ := io.ReadAll(po.Body)
-		_ = po.Body.Close()
-		return events.APIGatewayProxyResponse{StatusCode: 200, Body: string(b), Headers: map[string]string{"Content-Type": "application/json"}}, nil
+func getPost(ctx context.Context, idStr string) (events.APIGatewayProxyResponse, error) {
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return response.BadRequest("invalid id: must be a number"), nil
 	}
 
-	if method == http.MethodPost && path == "/posts" {
-		var p Post
-		if err := json.Unmarshal([]byte(req.Body), &p); err != nil || p.ID == 0 {
-			return errorJSON(400, "invalid body: require id,title,content")
-		}
+	post, err := repo.GetPost(ctx, id)
+	if err != nil {
+		return response.FromError(err), nil
+	}
 
-		key := fmt.Sprintf("posts/%d.json", p.ID)
-		b, _ := json.Marshal(p)
-		ct := "application/json"
-		_, err := s3Client.PutObject(ctx, &s3.PutObjectInput{Bucket: &bucket, Key: &key, Body: bytes.NewReader(b), ContentType: &ct})
-		if err != nil {
-			return errorJSON(500, "create failed")
-		}
-		return events.APIGatewayProxyResponse{StatusCode: 200, Body: string(b), Headers: map[string]string{"Content-Type": "application/json"}}, nil
+	return response.Success(post), nil
+}
+
+func createPost(ctx context.Context, body string) (events.APIGatewayProxyResponse, error) {
+	var post model.Post
+	if err := json.Unmarshal([]byte(body), &post); err != nil || post.ID == 0 {
+		return response.BadRequest("invalid body: require id,title,content"), nil
 	}
 
-	if method == http.MethodPut && strings.HasPrefix(path, "/posts/") {
-		idStr := strings.TrimPrefix(path, "/posts/")
-		id, err := strconv.Atoi(idStr)
-		if err != nil {
-			return errorJSON(400, "invalid id: must be a number")
-		}
-		key := fmt.Sprintf("posts/%d.json", id)
-		_, err = s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: &bucket, Key: &key})
-		if err != nil {
-			return errorJSON(500, "delete failed")
-		}
-		return events.APIGatewayProxyResponse{StatusCode: 204, Body: ""}, nil
+	now := time.Now()
+	post.CreatedAt = now
+	post.UpdatedAt = now
+
+	if err := svc.CreatePost(ctx, &post); err != nil {
+		return response.FromError(err), nil
+	}
+	if async {
+		return response.Accepted(post), nil
+	}
+
+	return response.Created(post), nil
+}
+
+func updatePost(ctx context.Context, idStr, body string) (events.APIGatewayProxyResponse, error) {
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return response.BadRequest("invalid id: must be a number"), nil
+	}
+
+	var post model.Post
+	if err := json.Unmarshal([]byte(body), &post); err != nil {
+		return response.BadRequest("invalid body"), nil
+	}
+
+	post.UpdatedAt = time.Now()
+
+	if err := svc.UpdatePost(ctx, id, &post); err != nil {
+		return response.FromError(err), nil
+	}
+	if async {
+		return response.Accepted(post), nil
+	}
+
+	return response.Success(post), nil
+}
+
+func deletePost(ctx context.Context, idStr string) (events.APIGatewayProxyResponse, error) {
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return response.BadRequest("invalid id: must be a number"), nil
+	}
+
+	if err := svc.DeletePost(ctx, id); err != nil {
+		return response.FromError(err), nil
+	}
+	if async {
+		return response.Accepted(nil), nil
+	}
+
+	return response.NoContent(), nil
+}
+
+// 添付ファイル用の署名付きアップロードURLを発行し、記事にメタデータを記録する
+// メタデータの記録はsvc経由で行い、非同期構成ではcreate/update/deleteと同じ
+// キュー(MessageGroupId)を通すことで、記事本体の書き込みと競合しないようにする
+func createAttachment(ctx context.Context, idStr, body string) (events.APIGatewayProxyResponse, error) {
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return response.BadRequest("invalid id: must be a number"), nil
+	}
+
+	var attachReq model.AttachmentRequest
+	if err := json.Unmarshal([]byte(body), &attachReq); err != nil || attachReq.Name == "" {
+		return response.BadRequest("invalid body: require name,content_type"), nil
+	}
+
+	attachment := model.Attachment{
+		Name:        attachReq.Name,
+		ContentType: attachReq.ContentType,
+	}
+	if err := svc.AddAttachment(ctx, id, attachment); err != nil {
+		return response.FromError(err), nil
+	}
+
+	key := repository.AttachmentKey(id, attachReq.Name)
+	url, err := repo.PresignPut(ctx, key, attachReq.ContentType, presignTTL)
+	if err != nil {
+		return response.FromError(err), nil
+	}
+
+	if async {
+		return response.Accepted(model.PresignedURLResponse{URL: url}), nil
+	}
+	return response.Created(model.PresignedURLResponse{URL: url}), nil
+}
+
+// 添付ファイル用の署名付きダウンロードURLを発行する
+func getAttachment(ctx context.Context, idStr, name string) (events.APIGatewayProxyResponse, error) {
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return response.BadRequest("invalid id: must be a number"), nil
+	}
+
+	key := repository.AttachmentKey(id, name)
+	url, err := repo.PresignGet(ctx, key, presignTTL)
+	if err != nil {
+		return response.FromError(err), nil
 	}
 
-	return errorJSON(404, "not found")
+	return response.Success(model.PresignedURLResponse{URL: url}), nil
 }
 
 func main() {
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+
+	"lambda/internal/model"
+	"lambda/internal/repository"
+	"lambda/internal/service"
+	"lambda/pkg/logger"
+)
+
+var (
+	repo *repository.S3Repository
+	svc  service.PostService
+)
+
+func init() {
+	bucket := os.Getenv("POSTS_BUCKET")
+
+	r, err := repository.NewS3Repository(bucket, repository.OptionsFromEnv()...)
+	if err != nil {
+		logger.Error("failed to initialize repository", "error", err)
+		os.Exit(1)
+	}
+	repo = r
+	svc = service.NewSyncPostService(repo)
+}
+
+// SQSに積まれた記事の書き込みリクエストを消費してS3へ反映する
+// 失敗したメッセージはBatchItemFailuresとして返し、可視性タイムアウト経過後に再試行される
+func handle(ctx context.Context, event events.SQSEvent) (events.SQSEventResponse, error) {
+	var failures []events.SQSBatchItemFailure
+
+	for _, record := range event.Records {
+		if err := process(ctx, record); err != nil {
+			logger.Error("failed to process message", "messageId", record.MessageId, "error", err)
+			failures = append(failures, events.SQSBatchItemFailure{ItemIdentifier: record.MessageId})
+		}
+	}
+
+	return events.SQSEventResponse{BatchItemFailures: failures}, nil
+}
+
+func process(ctx context.Context, record events.SQSMessage) error {
+	var envelope service.Envelope
+	if err := json.Unmarshal([]byte(record.Body), &envelope); err != nil {
+		return err
+	}
+
+	switch envelope.Op {
+	case service.OpCreate, service.OpUpdate:
+		var post model.Post
+		if err := json.Unmarshal(envelope.Payload, &post); err != nil {
+			return err
+		}
+		if envelope.Op == service.OpCreate {
+			return repo.CreatePost(ctx, &post)
+		}
+		return repo.UpdatePost(ctx, envelope.ID, &post)
+	case service.OpDelete:
+		return repo.DeletePost(ctx, envelope.ID)
+	case service.OpAddAttachment:
+		var attachment model.Attachment
+		if err := json.Unmarshal(envelope.Payload, &attachment); err != nil {
+			return err
+		}
+		return svc.AddAttachment(ctx, envelope.ID, attachment)
+	default:
+		logger.Error("unknown operation", "op", envelope.Op)
+		return nil
+	}
+}
+
+func main() {
+	lambda.Start(handle)
+}